@@ -18,6 +18,9 @@ package regen
 
 import (
 	"bytes"
+	"context"
+	"io"
+	"math/rand"
 	"runtime"
 	"strings"
 	"sync"
@@ -28,14 +31,314 @@ GeneratorExecutor runs a list of Generators and returns their results concatenat
 */
 type GeneratorExecutor interface {
 	Execute(generators []Generator) string
+
+	// ExecuteStream runs generators like Execute, but delivers each result on
+	// the returned channel as soon as it's produced instead of concatenating
+	// them. The channel is closed once every generator has produced a result,
+	// or, once ctx is done, as soon as the generators already running return;
+	// generators not yet started are skipped.
+	ExecuteStream(ctx context.Context, generators []Generator) <-chan IndexedResult
+
+	// ExecuteContext runs generators like Execute, but aborts and returns a
+	// GeneratorError whose Cause is ctx.Err() once ctx is canceled, skipping
+	// any generator not yet launched.
+	ExecuteContext(ctx context.Context, generators []Generator) (string, error)
+}
+
+// contextGenerator is an optional interface Generators may implement to
+// receive the context passed to GeneratorExecutor.ExecuteContext.
+type contextGenerator interface {
+	Generator
+	GenerateContext(ctx context.Context) string
+}
+
+func generateWithContext(ctx context.Context, generator Generator) string {
+	if cg, ok := generator.(contextGenerator); ok {
+		return cg.GenerateContext(ctx)
+	}
+	return generator.Generate()
+}
+
+// generateWithContextAndRand prefers generator's derived rand over plain
+// Generate, falling back to generateWithContext otherwise.
+func generateWithContextAndRand(ctx context.Context, generator Generator, i int, rands []*rand.Rand) string {
+	if rg, ok := generator.(randGenerator); ok && rands != nil {
+		return rg.GenerateWithRand(rands[i])
+	}
+	return generateWithContext(ctx, generator)
+}
+
+// randGenerator is an optional interface Generators may implement to receive
+// a dedicated *rand.Rand for a single call to Generate.
+type randGenerator interface {
+	Generator
+	GenerateWithRand(r *rand.Rand) string
+}
+
+// randSource is an optional interface Generators may implement to expose the
+// caller's seeded *rand.Rand, letting executors derive per-generator sub-seeds.
+type randSource interface {
+	Generator
+	Rand() *rand.Rand
+}
+
+// deriveRands draws a base seed from parent and derives n independent child
+// *rand.Rand, one per generator index, via the SplitMix64 mixing function.
+func deriveRands(parent *rand.Rand, n int) []*rand.Rand {
+	baseSeed := parent.Int63()
+	rands := make([]*rand.Rand, n, n)
+	for i := 0; i < n; i++ {
+		rands[i] = rand.New(rand.NewSource(splitMix64(baseSeed, i)))
+	}
+	return rands
+}
+
+// splitMix64 mixes parentSeed and i into a single child seed, using the
+// SplitMix64 finalizer.
+func splitMix64(parentSeed int64, i int) int64 {
+	z := uint64(parentSeed) + uint64(i+1)*0x9E3779B97F4A7C15
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return int64(z ^ (z >> 31))
+}
+
+// generateWithRands runs generator i against rands[i] if it implements
+// randGenerator, falling back to its plain Generate method otherwise.
+func generateWithRands(generators []Generator, i int, rands []*rand.Rand) string {
+	if rg, ok := generators[i].(randGenerator); ok && rands != nil {
+		return rg.GenerateWithRand(rands[i])
+	}
+	return generators[i].Generate()
+}
+
+// randsFor returns per-generator-index rands for generators, or nil if
+// generators doesn't expose a seeded randSource.
+func randsFor(generators []Generator) []*rand.Rand {
+	if len(generators) == 0 {
+		return nil
+	}
+	if rs, ok := generators[0].(randSource); ok {
+		return deriveRands(rs.Rand(), len(generators))
+	}
+	return nil
+}
+
+// executeWithContext underlies every GeneratorExecutor's ExecuteContext: like
+// workerPoolExecutor.Execute's pool, but skips generators once ctx is canceled.
+func executeWithContext(ctx context.Context, generators []Generator, numWorkers int) (string, error) {
+	numGens := len(generators)
+	results := make([]string, numGens, numGens)
+	rands := randsFor(generators)
+
+	type job struct {
+		index     int
+		generator Generator
+	}
+
+	jobs := make(chan job, numGens)
+	for i, generator := range generators {
+		jobs <- job{i, generator}
+	}
+	close(jobs)
+
+	if numWorkers < 1 {
+		numWorkers = numCpu
+	}
+	if numWorkers > numGens {
+		numWorkers = numGens
+	}
+
+	var waiter sync.WaitGroup
+	waiter.Add(numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		go func() {
+			defer waiter.Done()
+			for j := range jobs {
+				select {
+				case <-ctx.Done():
+					return
+				default:
+					results[j.index] = generateWithContextAndRand(ctx, j.generator, j.index, rands)
+				}
+			}
+		}()
+	}
+	waiter.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return "", generatorError(err, "generator execution canceled")
+	}
+
+	return strings.Join(results, ""), nil
+}
+
+// IndexedResult pairs a generated string with the index of the generator
+// that produced it, within the slice passed to ExecuteStream.
+type IndexedResult struct {
+	Index  int
+	Result string
+}
+
+// StreamingExecutor runs a list of Generators and streams their results as
+// they complete, with no ordering guarantee.
+type StreamingExecutor interface {
+	Stream(generators []Generator) <-chan string
+}
+
+type fanInExecutor struct{}
+
+// NewFanInExecutor returns a StreamingExecutor that runs generators across a
+// bounded pool of numCpu goroutines and interleaves their output as it
+// completes.
+func NewFanInExecutor() StreamingExecutor {
+	return fanInExecutor{}
+}
+
+func (fanInExecutor) Stream(generators []Generator) <-chan string {
+	numGens := len(generators)
+	rands := randsFor(generators)
+
+	numWorkers := numCpu
+	if numWorkers > numGens {
+		numWorkers = numGens
+	}
+	out := make(chan string, numWorkers)
+
+	type job struct {
+		index     int
+		generator Generator
+	}
+
+	jobs := make(chan job, numGens)
+	for i, generator := range generators {
+		jobs <- job{i, generator}
+	}
+	close(jobs)
+
+	var waiter sync.WaitGroup
+	waiter.Add(numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		go func() {
+			defer waiter.Done()
+			for j := range jobs {
+				out <- generateWithRands(generators, j.index, rands)
+			}
+		}()
+	}
+
+	go func() {
+		waiter.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// StreamingGenerator is implemented by Generators that can produce their
+// output incrementally rather than all at once.
+type StreamingGenerator interface {
+	Generator
+
+	// GenerateStream returns a channel of generated output, closed when ctx
+	// is done or the generator has no more output to produce.
+	GenerateStream(ctx context.Context) <-chan string
+
+	// GenerateReader returns an io.Reader streaming the same output as GenerateStream.
+	GenerateReader() io.Reader
+}
+
+// NewGeneratorReader returns an io.Reader for generator's output, via
+// GenerateReader if generator is a StreamingGenerator, or a single Generate call otherwise.
+func NewGeneratorReader(generator Generator) io.Reader {
+	if sg, ok := generator.(StreamingGenerator); ok {
+		return sg.GenerateReader()
+	}
+	return strings.NewReader(generator.Generate())
+}
+
+// streamGenerator writes generator's output to out under index, one
+// IndexedResult per GenerateStream chunk, or a single one from Generate (or
+// GenerateWithRand, if rands is non-nil and generator supports it, or
+// GenerateContext, if generator supports that instead).
+func streamGenerator(ctx context.Context, index int, generator Generator, rands []*rand.Rand, out chan<- IndexedResult) {
+	if sg, ok := generator.(StreamingGenerator); ok {
+		for chunk := range sg.GenerateStream(ctx) {
+			out <- IndexedResult{index, chunk}
+		}
+		return
+	}
+	out <- IndexedResult{index, generateWithContextAndRand(ctx, generator, index, rands)}
+}
+
+// streamGenerators underlies every GeneratorExecutor's ExecuteStream: it runs
+// generators across numWorkers goroutines and closes the channel once done,
+// or once ctx is done, skipping any generator not yet started.
+func streamGenerators(ctx context.Context, generators []Generator, numWorkers int) <-chan IndexedResult {
+	numGens := len(generators)
+	out := make(chan IndexedResult, numGens)
+	rands := randsFor(generators)
+
+	if numWorkers < 1 {
+		numWorkers = numCpu
+	}
+	if numWorkers > numGens {
+		numWorkers = numGens
+	}
+
+	type job struct {
+		index     int
+		generator Generator
+	}
+
+	jobs := make(chan job, numGens)
+	for i, generator := range generators {
+		jobs <- job{i, generator}
+	}
+	close(jobs)
+
+	var waiter sync.WaitGroup
+	waiter.Add(numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		go func() {
+			defer waiter.Done()
+			for j := range jobs {
+				select {
+				case <-ctx.Done():
+					return
+				default:
+					streamGenerator(ctx, j.index, j.generator, rands, out)
+				}
+			}
+		}()
+	}
+
+	go func() {
+		waiter.Wait()
+		close(out)
+	}()
+
+	return out
 }
 
 type serialExecutor struct{}
 
 type forkJoinExecutor struct{}
 
+type workerPoolExecutor struct {
+	numWorkers int
+}
+
+type adaptiveExecutor struct{}
+
 var numCpu = runtime.NumCPU()
 
+// adaptiveForkJoinThreshold and adaptiveWorkerPoolThreshold are the
+// len(generators) cutoffs NewAdaptiveExecutor switches on.
+const (
+	adaptiveForkJoinThreshold   = 32
+	adaptiveWorkerPoolThreshold = 4096
+)
+
 // Execute executes a single generator n times.
 func executeGeneratorRepeatedly(executor GeneratorExecutor, generator Generator, n int) string {
 	generators := make([]Generator, n, n)
@@ -56,14 +359,23 @@ func NewSerialExecutor() GeneratorExecutor {
 func (serialExecutor) Execute(generators []Generator) string {
 	var buffer bytes.Buffer
 	numGens := len(generators)
+	rands := randsFor(generators)
 
 	for i := 0; i < numGens; i++ {
-		buffer.WriteString(generators[i].Generate())
+		buffer.WriteString(generateWithRands(generators, i, rands))
 	}
 
 	return buffer.String()
 }
 
+func (serialExecutor) ExecuteStream(ctx context.Context, generators []Generator) <-chan IndexedResult {
+	return streamGenerators(ctx, generators, 1)
+}
+
+func (serialExecutor) ExecuteContext(ctx context.Context, generators []Generator) (string, error) {
+	return executeWithContext(ctx, generators, 1)
+}
+
 /*
 NewForkJoinExecutor returns an executor that runs each generator
 on its own goroutine.
@@ -78,16 +390,118 @@ func NewForkJoinExecutor() GeneratorExecutor {
 func (forkJoinExecutor) Execute(generators []Generator) string {
 	numGens := len(generators)
 	results := make([]string, numGens, numGens)
+	rands := randsFor(generators)
 	var waiter sync.WaitGroup
 
 	waiter.Add(numGens)
 	for i := 0; i < numGens; i++ {
 		go func(i int) {
 			defer waiter.Done()
-			results[i] = generators[i].Generate()
+			results[i] = generateWithRands(generators, i, rands)
 		}(i)
 	}
 	waiter.Wait()
 
 	return strings.Join(results, "")
 }
+
+func (forkJoinExecutor) ExecuteStream(ctx context.Context, generators []Generator) <-chan IndexedResult {
+	return streamGenerators(ctx, generators, len(generators))
+}
+
+func (forkJoinExecutor) ExecuteContext(ctx context.Context, generators []Generator) (string, error) {
+	return executeWithContext(ctx, generators, len(generators))
+}
+
+// NewWorkerPoolExecutor returns an executor that runs generators across a
+// fixed pool of numWorkers goroutines. If numWorkers is less than 1,
+// runtime.NumCPU() is used instead.
+func NewWorkerPoolExecutor(numWorkers int) GeneratorExecutor {
+	if numWorkers < 1 {
+		numWorkers = numCpu
+	}
+	return workerPoolExecutor{numWorkers}
+}
+
+func (e workerPoolExecutor) Execute(generators []Generator) string {
+	numGens := len(generators)
+	results := make([]string, numGens, numGens)
+	rands := randsFor(generators)
+
+	type job struct {
+		index     int
+		generator Generator
+	}
+
+	jobs := make(chan job, numGens)
+	for i, generator := range generators {
+		jobs <- job{i, generator}
+	}
+	close(jobs)
+
+	var waiter sync.WaitGroup
+	numWorkers := e.numWorkers
+	if numWorkers > numGens {
+		numWorkers = numGens
+	}
+
+	waiter.Add(numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		go func() {
+			defer waiter.Done()
+			for j := range jobs {
+				results[j.index] = generateWithRands(generators, j.index, rands)
+			}
+		}()
+	}
+	waiter.Wait()
+
+	return strings.Join(results, "")
+}
+
+func (e workerPoolExecutor) ExecuteStream(ctx context.Context, generators []Generator) <-chan IndexedResult {
+	return streamGenerators(ctx, generators, e.numWorkers)
+}
+
+func (e workerPoolExecutor) ExecuteContext(ctx context.Context, generators []Generator) (string, error) {
+	return executeWithContext(ctx, generators, e.numWorkers)
+}
+
+// NewAdaptiveExecutor returns an executor that picks serialExecutor,
+// forkJoinExecutor, or workerPoolExecutor based on len(generators).
+func NewAdaptiveExecutor() GeneratorExecutor {
+	return adaptiveExecutor{}
+}
+
+func (adaptiveExecutor) Execute(generators []Generator) string {
+	switch numGens := len(generators); {
+	case numGens < adaptiveForkJoinThreshold:
+		return NewSerialExecutor().Execute(generators)
+	case numGens < adaptiveWorkerPoolThreshold:
+		return NewForkJoinExecutor().Execute(generators)
+	default:
+		return NewWorkerPoolExecutor(numCpu).Execute(generators)
+	}
+}
+
+func (adaptiveExecutor) ExecuteStream(ctx context.Context, generators []Generator) <-chan IndexedResult {
+	switch numGens := len(generators); {
+	case numGens < adaptiveForkJoinThreshold:
+		return NewSerialExecutor().ExecuteStream(ctx, generators)
+	case numGens < adaptiveWorkerPoolThreshold:
+		return NewForkJoinExecutor().ExecuteStream(ctx, generators)
+	default:
+		return NewWorkerPoolExecutor(numCpu).ExecuteStream(ctx, generators)
+	}
+}
+
+func (adaptiveExecutor) ExecuteContext(ctx context.Context, generators []Generator) (string, error) {
+	switch numGens := len(generators); {
+	case numGens < adaptiveForkJoinThreshold:
+		return NewSerialExecutor().ExecuteContext(ctx, generators)
+	case numGens < adaptiveWorkerPoolThreshold:
+		return NewForkJoinExecutor().ExecuteContext(ctx, generators)
+	default:
+		return NewWorkerPoolExecutor(numCpu).ExecuteContext(ctx, generators)
+	}
+}
@@ -0,0 +1,432 @@
+/*
+Copyright 2014 Zachary Klippenstein
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package regen
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testGenerator is a Generator that always returns s, for exercising
+// executors without depending on a real pattern generator.
+type testGenerator struct {
+	s string
+}
+
+func (g testGenerator) Generate() string { return g.s }
+
+// blockingGenerator closes started as soon as Generate is called, then
+// blocks until unblock is closed, for tests that need to cancel a context
+// while a generator is in flight.
+type blockingGenerator struct {
+	s       string
+	started chan struct{}
+	unblock <-chan struct{}
+}
+
+func (g blockingGenerator) Generate() string {
+	close(g.started)
+	<-g.unblock
+	return g.s
+}
+
+// trackingGenerator sends on ran when Generate is called, for tests that
+// need to assert a generator was (or wasn't) started.
+type trackingGenerator struct {
+	s   string
+	ran chan<- struct{}
+}
+
+func (g trackingGenerator) Generate() string {
+	g.ran <- struct{}{}
+	return g.s
+}
+
+// fakeStreamingGenerator is a StreamingGenerator that emits chunks one at a
+// time over GenerateStream, for exercising the StreamingGenerator dispatch
+// branches of streamGenerator and NewGeneratorReader.
+type fakeStreamingGenerator struct {
+	chunks []string
+}
+
+func (g fakeStreamingGenerator) Generate() string { return strings.Join(g.chunks, "") }
+
+func (g fakeStreamingGenerator) GenerateStream(ctx context.Context) <-chan string {
+	out := make(chan string)
+	go func() {
+		defer close(out)
+		for _, chunk := range g.chunks {
+			select {
+			case <-ctx.Done():
+				return
+			case out <- chunk:
+			}
+		}
+	}()
+	return out
+}
+
+func (g fakeStreamingGenerator) GenerateReader() io.Reader {
+	return strings.NewReader(g.Generate())
+}
+
+// ctxValueGenerator is a contextGenerator that echoes back the string stored
+// under key in the ctx it's given, for verifying generateWithContext
+// dispatches to GenerateContext and forwards the caller's actual ctx rather
+// than a fresh one.
+type ctxValueGenerator struct {
+	key interface{}
+}
+
+func (g ctxValueGenerator) Generate() string { return "fallback" }
+
+func (g ctxValueGenerator) GenerateContext(ctx context.Context) string {
+	v, _ := ctx.Value(g.key).(string)
+	return v
+}
+
+// benchSmallN and benchLargeN are batch sizes picked independently of
+// adaptiveForkJoinThreshold/adaptiveWorkerPoolThreshold, so the benchmarks
+// below can actually validate or falsify those cutoffs instead of assuming
+// them.
+const (
+	benchSmallN = 16
+	benchLargeN = 8192
+)
+
+// benchGeneratorCost is how much non-trivial work costlyTestGenerator.Generate
+// does, so executor overhead is measured against a representative generator
+// instead of a no-op that makes goroutine/channel overhead dominate.
+const benchGeneratorCost = 1000
+
+// costlyTestGenerator is a Generator with non-trivial CPU cost, standing in
+// for a real pattern generator in the benchmarks below.
+type costlyTestGenerator struct{}
+
+func (costlyTestGenerator) Generate() string {
+	var buf bytes.Buffer
+	for i := 0; i < benchGeneratorCost; i++ {
+		buf.WriteByte(byte(i))
+	}
+	return buf.String()
+}
+
+func benchmarkExecuteN(b *testing.B, executor GeneratorExecutor, n int) {
+	generator := costlyTestGenerator{}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		executeGeneratorRepeatedly(executor, generator, n)
+	}
+}
+
+// These benchmarks sanity-check NewAdaptiveExecutor's cutoffs at batch sizes
+// around benchSmallN/benchLargeN, against a generator with non-trivial cost;
+// they don't claim a fixed winner at either size, since that depends on
+// generator cost and machine. Run with -bench to compare executors before
+// changing adaptiveForkJoinThreshold/adaptiveWorkerPoolThreshold.
+func BenchmarkSerialExecutorSmall(b *testing.B) {
+	benchmarkExecuteN(b, NewSerialExecutor(), benchSmallN)
+}
+func BenchmarkForkJoinExecutorSmall(b *testing.B) {
+	benchmarkExecuteN(b, NewForkJoinExecutor(), benchSmallN)
+}
+func BenchmarkWorkerPoolExecutorSmall(b *testing.B) {
+	benchmarkExecuteN(b, NewWorkerPoolExecutor(0), benchSmallN)
+}
+
+func BenchmarkSerialExecutorLarge(b *testing.B) {
+	benchmarkExecuteN(b, NewSerialExecutor(), benchLargeN)
+}
+func BenchmarkForkJoinExecutorLarge(b *testing.B) {
+	benchmarkExecuteN(b, NewForkJoinExecutor(), benchLargeN)
+}
+func BenchmarkWorkerPoolExecutorLarge(b *testing.B) {
+	benchmarkExecuteN(b, NewWorkerPoolExecutor(0), benchLargeN)
+}
+
+func benchmarkStreamN(b *testing.B, executor StreamingExecutor, n int) {
+	generator := costlyTestGenerator{}
+	generators := make([]Generator, n)
+	for i := range generators {
+		generators[i] = generator
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for range executor.Stream(generators) {
+		}
+	}
+}
+
+// Compare against BenchmarkForkJoinExecutor{Small,Large} above.
+func BenchmarkFanInExecutorSmall(b *testing.B) { benchmarkStreamN(b, NewFanInExecutor(), benchSmallN) }
+func BenchmarkFanInExecutorLarge(b *testing.B) { benchmarkStreamN(b, NewFanInExecutor(), benchLargeN) }
+
+// TestWorkerPoolExecutorPreservesOrder guards the indexed-write path that lets
+// workerPoolExecutor preserve result order despite processing jobs out of
+// order across workers; run with -race to catch any write races on results.
+func TestWorkerPoolExecutorPreservesOrder(t *testing.T) {
+	const n = 500
+	generators := make([]Generator, n)
+	want := make([]string, n)
+	for i := 0; i < n; i++ {
+		s := strconv.Itoa(i)
+		generators[i] = testGenerator{s: s}
+		want[i] = s
+	}
+
+	got := NewWorkerPoolExecutor(8).Execute(generators)
+	if wantStr := strings.Join(want, ""); got != wantStr {
+		t.Fatalf("workerPoolExecutor reordered results:\n got: %s\nwant: %s", got, wantStr)
+	}
+}
+
+// TestDeriveRandsDeterministic verifies that deriveRands reproduces the same
+// per-generator-index streams given the same parent seed.
+func TestDeriveRandsDeterministic(t *testing.T) {
+	const n = 8
+	rands1 := deriveRands(rand.New(rand.NewSource(42)), n)
+	rands2 := deriveRands(rand.New(rand.NewSource(42)), n)
+
+	for i := 0; i < n; i++ {
+		if a, b := rands1[i].Int63(), rands2[i].Int63(); a != b {
+			t.Fatalf("rand stream %d diverged across runs: %d != %d", i, a, b)
+		}
+	}
+}
+
+// TestDeriveRandsIndependent verifies that sibling rands derived from one
+// parent don't produce identical streams.
+func TestDeriveRandsIndependent(t *testing.T) {
+	rands := deriveRands(rand.New(rand.NewSource(1)), 4)
+
+	seen := make(map[int64]bool, len(rands))
+	for i, r := range rands {
+		v := r.Int63()
+		if seen[v] {
+			t.Fatalf("child rand %d collided with a sibling on its first draw: %d", i, v)
+		}
+		seen[v] = true
+	}
+}
+
+// randTestGenerator is a Generator that exposes a seeded *rand.Rand via
+// randSource, and draws from whatever *rand.Rand it's handed via randGenerator,
+// for verifying that every executor path threads derived rands through.
+type randTestGenerator struct {
+	r *rand.Rand
+}
+
+func (g randTestGenerator) Generate() string { return "unseeded" }
+func (g randTestGenerator) Rand() *rand.Rand { return g.r }
+func (g randTestGenerator) GenerateWithRand(r *rand.Rand) string {
+	return strconv.FormatInt(r.Int63(), 10)
+}
+
+// newSeededGenerators returns n randTestGenerators whose first element
+// exposes a *rand.Rand seeded from seed, for deriveRands to split from.
+func newSeededGenerators(seed int64, n int) []Generator {
+	generators := make([]Generator, n)
+	generators[0] = randTestGenerator{r: rand.New(rand.NewSource(seed))}
+	for i := 1; i < n; i++ {
+		generators[i] = randTestGenerator{}
+	}
+	return generators
+}
+
+// collectOrdered reconstructs the concatenated, index-ordered string from an
+// ExecuteStream channel of n results.
+func collectOrdered(ch <-chan IndexedResult, n int) string {
+	results := make([]string, n)
+	for ir := range ch {
+		results[ir.Index] = ir.Result
+	}
+	return strings.Join(results, "")
+}
+
+// TestExecutorsAgreeOnSeededOutput verifies that serialExecutor,
+// forkJoinExecutor, and workerPoolExecutor all regenerate identical output
+// for the same seed, via both Execute and ExecuteStream.
+func TestExecutorsAgreeOnSeededOutput(t *testing.T) {
+	const n = 50
+	const seed = 7
+
+	executors := []GeneratorExecutor{
+		NewSerialExecutor(),
+		NewForkJoinExecutor(),
+		NewWorkerPoolExecutor(4),
+	}
+
+	want := executors[0].Execute(newSeededGenerators(seed, n))
+	for i, executor := range executors {
+		if got := executor.Execute(newSeededGenerators(seed, n)); got != want {
+			t.Fatalf("executor %d Execute = %q, want %q", i, got, want)
+		}
+		if got := collectOrdered(executor.ExecuteStream(context.Background(), newSeededGenerators(seed, n)), n); got != want {
+			t.Fatalf("executor %d ExecuteStream = %q, want %q", i, got, want)
+		}
+	}
+}
+
+// TestExecuteContextCancelsMidBatch verifies that ExecuteContext aborts once
+// ctx is canceled while a generator is in flight, returns a GeneratorError
+// wrapping ctx.Err(), and never starts a generator queued behind it.
+func TestExecuteContextCancelsMidBatch(t *testing.T) {
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	ran := make(chan struct{}, 1)
+
+	generators := []Generator{
+		blockingGenerator{s: "first", started: started, unblock: unblock},
+		trackingGenerator{s: "second", ran: ran},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type result struct {
+		s   string
+		err error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		s, err := NewWorkerPoolExecutor(1).ExecuteContext(ctx, generators)
+		resultCh <- result{s, err}
+	}()
+
+	<-started
+	cancel()
+	close(unblock)
+
+	res := <-resultCh
+	if res.err == nil {
+		t.Fatalf("ExecuteContext returned nil error after ctx was canceled")
+	}
+	genErr, ok := res.err.(GeneratorError)
+	if !ok {
+		t.Fatalf("ExecuteContext error = %T, want GeneratorError", res.err)
+	}
+	if genErr.Cause != context.Canceled {
+		t.Fatalf("GeneratorError.Cause = %v, want context.Canceled", genErr.Cause)
+	}
+
+	select {
+	case <-ran:
+		t.Fatalf("second generator ran after ctx was canceled")
+	default:
+	}
+}
+
+// TestFanInExecutorMergesAllResults verifies that fanInExecutor.Stream's
+// bounded worker pool still runs every generator exactly once and delivers
+// all of their results, despite interleaving them across fewer goroutines
+// than generators.
+func TestFanInExecutorMergesAllResults(t *testing.T) {
+	const n = 200
+	generators := make([]Generator, n)
+	want := make(map[string]int, n)
+	for i := 0; i < n; i++ {
+		s := strconv.Itoa(i)
+		generators[i] = testGenerator{s: s}
+		want[s]++
+	}
+
+	got := make(map[string]int, n)
+	count := 0
+	for s := range NewFanInExecutor().Stream(generators) {
+		got[s]++
+		count++
+	}
+
+	if count != n {
+		t.Fatalf("fanInExecutor delivered %d results, want %d", count, n)
+	}
+	for s, wantCount := range want {
+		if got[s] != wantCount {
+			t.Fatalf("result %q delivered %d times, want %d", s, got[s], wantCount)
+		}
+	}
+}
+
+// TestExecuteStreamUsesGenerateStream verifies that ExecuteStream dispatches
+// a StreamingGenerator to GenerateStream, delivering one IndexedResult per
+// chunk rather than collapsing it into a single Generate call.
+func TestExecuteStreamUsesGenerateStream(t *testing.T) {
+	generators := []Generator{
+		fakeStreamingGenerator{chunks: []string{"a", "b", "c"}},
+		testGenerator{s: "z"},
+	}
+
+	chunks := make(map[int][]string)
+	for ir := range NewForkJoinExecutor().ExecuteStream(context.Background(), generators) {
+		chunks[ir.Index] = append(chunks[ir.Index], ir.Result)
+	}
+
+	if len(chunks[0]) != 3 {
+		t.Fatalf("StreamingGenerator delivered %d chunks, want 3: %v", len(chunks[0]), chunks[0])
+	}
+	if got := strings.Join(chunks[0], ""); got != "abc" {
+		t.Fatalf("StreamingGenerator chunks joined = %q, want %q", got, "abc")
+	}
+	if got := strings.Join(chunks[1], ""); got != "z" {
+		t.Fatalf("plain generator result = %q, want %q", got, "z")
+	}
+}
+
+// TestNewGeneratorReader verifies that NewGeneratorReader dispatches to
+// GenerateReader for a StreamingGenerator, and falls back to a single
+// Generate call otherwise.
+func TestNewGeneratorReader(t *testing.T) {
+	streaming := fakeStreamingGenerator{chunks: []string{"x", "y"}}
+	got, err := io.ReadAll(NewGeneratorReader(streaming))
+	if err != nil {
+		t.Fatalf("ReadAll(NewGeneratorReader(streaming)): %v", err)
+	}
+	if string(got) != "xy" {
+		t.Fatalf("NewGeneratorReader(streaming) content = %q, want %q", got, "xy")
+	}
+
+	plain := testGenerator{s: "plain"}
+	got, err = io.ReadAll(NewGeneratorReader(plain))
+	if err != nil {
+		t.Fatalf("ReadAll(NewGeneratorReader(plain)): %v", err)
+	}
+	if string(got) != "plain" {
+		t.Fatalf("NewGeneratorReader(plain) content = %q, want %q", got, "plain")
+	}
+}
+
+// TestExecuteContextDispatchesToGenerateContext verifies that ExecuteContext
+// dispatches a contextGenerator to GenerateContext instead of falling back
+// to Generate, and forwards its own ctx rather than a fresh one.
+func TestExecuteContextDispatchesToGenerateContext(t *testing.T) {
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "marker")
+
+	got, err := NewForkJoinExecutor().ExecuteContext(ctx, []Generator{ctxValueGenerator{key: ctxKey{}}})
+	if err != nil {
+		t.Fatalf("ExecuteContext: %v", err)
+	}
+	if got != "marker" {
+		t.Fatalf("ExecuteContext result = %q, want %q (GenerateContext not dispatched with caller's ctx)", got, "marker")
+	}
+}